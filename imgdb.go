@@ -8,17 +8,23 @@ package imgdb
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/hex"
 	"fmt"
 	"image"
+	"image/draw"
+	"image/gif"
 	_ "image/jpeg"
 	_ "image/png"
 	"io"
 	"math"
+	"math/bits"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"sync"
 
 	"github.com/jinzhu/gorm"
@@ -26,6 +32,7 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
 	"github.com/mingkaic/imgdb/imgutil"
+	"golang.org/x/sync/errgroup"
 )
 
 // =============================================
@@ -36,10 +43,12 @@ import (
 // Is a wrapper gorm for images
 type ImgDB struct {
 	*gorm.DB
-	MinW     uint
-	MinH     uint
-	basePath string
-	mutex    sync.RWMutex
+	MinW         uint
+	MinH         uint
+	FeatConfig   imgutil.FeatureConfig
+	basePath     string
+	dbMutex      sync.RWMutex
+	clusterLocks sync.Map // clusterName (string) -> *sync.Mutex
 }
 
 //// Models
@@ -49,6 +58,7 @@ type ImgDB struct {
 type Cluster struct {
 	gorm.Model
 	Name       string `gorm:"not null;unique"`
+	Label      string
 	ImageFiles []ImageFile
 }
 
@@ -56,9 +66,12 @@ type Cluster struct {
 // Specifies name information and image features
 type ImageFile struct {
 	gorm.Model
-	Name      string `gorm:"not null;unique"`
-	Format    string `gorm:"not null"`
-	Index     []byte `gorm:"not null"`
+	Name   string `gorm:"not null;unique"`
+	Format string `gorm:"not null"`
+	Index  []byte `gorm:"not null"`
+	// PHash is bit-reinterpreted from imgutil.PerceptualHash's uint64, since
+	// mattn/go-sqlite3 rejects uint64 values with the high bit set
+	PHash     int64
 	Sources   []Source
 	ClusterID int
 }
@@ -76,13 +89,36 @@ type DupFileError struct {
 	dupfile  string
 }
 
+// DistanceFunc ...
+// Measures similarity between two feature vectors
+// Lower values indicate more similar images
+type DistanceFunc func(feat1, feat2 []float32) float64
+
+// ImageMatch ...
+// Specifies a single ranked result of a Query call
+type ImageMatch struct {
+	Name        string
+	Format      string
+	ClusterName string
+	Path        string
+	Distance    float64
+}
+
 // =============================================
 //                    Globals
 // =============================================
 
 const (
-	chiThresh = 5e-3
-	minLimit  = 500
+	chiThresh     = 5e-3
+	minLimit      = 500
+	clusterHamMax = 2
+	// phashThresh bounds how many differing bits two perceptual hashes
+	// may have before they're considered too dissimilar to be near-dupes;
+	// anything past this skips the costlier ChiDist sweep entirely
+	phashThresh = 10
+	// labelEpsilon avoids divide-by-zero when weighting an exact match
+	// (distance 0) during Predict's neighbor vote
+	labelEpsilon = 1e-6
 )
 
 var rando = rand.Reader
@@ -93,17 +129,30 @@ var rando = rand.Reader
 
 // New ...
 // Initializes and migrates relevant schemas
-func New(dialect, source, filedir string) (out *ImgDB, err error) {
+// cfg is optional and defaults to imgutil.DefaultFeatureConfig(); it
+// determines how features are extracted during AddImg and Query, and is
+// fingerprinted into cluster names so lookups never mix descriptors
+// extracted under different configs
+func New(dialect, source, filedir string, cfg ...imgutil.FeatureConfig) (out *ImgDB, err error) {
+	featConfig := imgutil.DefaultFeatureConfig()
+	if len(cfg) > 0 {
+		featConfig = cfg[0]
+	}
+	if err = featConfig.Validate(); err != nil {
+		return
+	}
+
 	db, err := gorm.Open(dialect, source)
 	if err != nil {
 		return
 	}
 	db.AutoMigrate(&Cluster{}, &ImageFile{}, &Source{})
 	out = &ImgDB{
-		DB:       db,
-		MinW:     minLimit,
-		MinH:     minLimit,
-		basePath: filedir,
+		DB:         db,
+		MinW:       minLimit,
+		MinH:       minLimit,
+		FeatConfig: featConfig,
+		basePath:   filedir,
 	}
 	err = os.MkdirAll(filedir, 0755)
 	return
@@ -115,6 +164,11 @@ func New(dialect, source, filedir string) (out *ImgDB, err error) {
 // Filters out images too small beyond a limit
 // Index and logic inspired from https://tinyurl.com/yaup47bg
 func (this *ImgDB) AddImg(name string, data []byte) (imgModel *ImageFile, err error) {
+	name, err = sanitizeName(name)
+	if err != nil {
+		return
+	}
+
 	img, format, err := image.Decode(bytes.NewBuffer(data))
 
 	// size filter
@@ -130,30 +184,51 @@ func (this *ImgDB) AddImg(name string, data []byte) (imgModel *ImageFile, err er
 		return
 	}
 
+	// cheap perceptual pre-filter, computed off the first/only frame
+	pHash := imgutil.PerceptualHash(img)
+
 	// feature extraction
-	features := imgutil.GenerateFeature(img, format)
+	features, err := this.extractFeatures(data, img, format)
+	if err != nil {
+		return
+	}
 	if features == nil {
 		err = fmt.Errorf("failed to extract features for %s", name)
 		return
 	}
 
 	filename := name + "." + format
-	clusterName := bitApproximation(features)
-	imgModel = &ImageFile{Name: name, Format: format, Index: stringify(features)}
+	clusterName := this.FeatConfig.Hash() + bitApproximation(features)
+	imgModel = &ImageFile{Name: name, Format: format, Index: stringify(features), PHash: int64(pHash)}
+
+	// hold the cluster lock across the whole read-check-write sequence so
+	// two inserts landing in the same cluster can't both pass the
+	// duplicate check before either writes; inserts into different
+	// clusters proceed concurrently
+	clusterMu := this.getClusterLock(clusterName)
+	clusterMu.Lock()
+	defer clusterMu.Unlock()
 
 	// ==== begin reading from db ====
 	// asserts that gorm api calls are thread-safe
-	this.mutex.RLock()
+	this.dbMutex.RLock()
 	cluster := getCluster(this, clusterName)
 	if cluster != nil {
 		// similarity check
 		// 1. check for duplicate features to avoid pollution
 		imgFiles := getAssocs(this, cluster)
 		for _, file := range imgFiles {
+			// fast pre-filter: too dissimilar perceptually to be a near-dupe,
+			// skip the O(n) ChiDist sweep for this candidate
+			if imgutil.HammingDist(pHash, uint64(file.PHash)) > phashThresh {
+				continue
+			}
 			// test similarity between new file and file
 			sim := imgutil.ChiDist(features, featureParse(file.Index))
 			if sim < chiThresh { // too similar beyond a threshold is marked as same
+				imgModel = nil
 				err = &DupFileError{file.Name + "." + file.Format, filename}
+				this.dbMutex.RUnlock()
 				return
 			}
 		}
@@ -167,17 +242,21 @@ func (this *ImgDB) AddImg(name string, data []byte) (imgModel *ImageFile, err er
 		imgModel.Name += string(appendage[:])
 		filename = imgModel.Name + "." + format
 	}
-	this.mutex.RUnlock()
+	this.dbMutex.RUnlock()
 	// ==== end reading from db ====
 
 	// ==== begin writing to db ====
 	// associate image model
-	this.mutex.Lock()
+	this.dbMutex.Lock()
 	if cluster == nil {
 		cluster = createCluster(this, clusterName)
 	}
-	this.Model(cluster).Association("ImageFiles").Append(*imgModel)
-	this.mutex.Unlock()
+	assoc := this.Model(cluster).Association("ImageFiles").Append(*imgModel)
+	this.dbMutex.Unlock()
+	if assoc.Error != nil {
+		err = assoc.Error
+		return
+	}
 	// ==== end writing to db ====
 
 	// write to file (invariant: filename is unique)
@@ -194,6 +273,115 @@ func (this *ImgDB) AddImg(name string, data []byte) (imgModel *ImageFile, err er
 	return
 }
 
+// extractFeatures dispatches to GenerateMultiFrameFeature for gif inputs
+// (decoded frame-by-frame so the descriptor captures motion via mean +
+// variance, rather than just the first frame) or GenerateFeature otherwise.
+// AddImg and Query must agree on this dispatch, since a gif queried with
+// only its first-frame feature would never match the multi-frame
+// descriptor it was indexed under.
+func (this *ImgDB) extractFeatures(data []byte, img image.Image, format string) ([]float32, error) {
+	if format != "gif" {
+		return imgutil.GenerateFeature(img, format, this.FeatConfig), nil
+	}
+	anim, err := gif.DecodeAll(bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+	return imgutil.GenerateMultiFrameFeature(compositeGifFrames(anim), this.FeatConfig), nil
+}
+
+// compositeGifFrames renders each frame of anim onto a full-canvas image,
+// honoring each frame's disposal method. Most real-world gif encoders emit
+// frames as "dirty rectangles" (only the changed sub-region, at a non-zero
+// offset) rather than full, origin-aligned canvases, so feeding anim.Image
+// straight into a histogram would describe only that sub-region and drop
+// everything the frame inherited from its predecessor.
+func compositeGifFrames(anim *gif.GIF) []image.Image {
+	bounds := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	frames := make([]image.Image, len(anim.Image))
+
+	var prevDisposal byte
+	var prevRect image.Rectangle
+	var prevCanvas *image.RGBA
+	for i, frame := range anim.Image {
+		if i > 0 {
+			switch prevDisposal {
+			case gif.DisposalBackground:
+				draw.Draw(canvas, prevRect, image.Transparent, image.Point{}, draw.Src)
+			case gif.DisposalPrevious:
+				if prevCanvas != nil {
+					draw.Draw(canvas, bounds, prevCanvas, image.Point{}, draw.Src)
+				}
+			}
+		}
+
+		var snapshot *image.RGBA
+		if anim.Disposal[i] == gif.DisposalPrevious {
+			snapshot = image.NewRGBA(bounds)
+			draw.Draw(snapshot, bounds, canvas, image.Point{}, draw.Src)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		composited := image.NewRGBA(bounds)
+		draw.Draw(composited, bounds, canvas, image.Point{}, draw.Src)
+		frames[i] = composited
+
+		prevDisposal = anim.Disposal[i]
+		prevRect = frame.Bounds()
+		prevCanvas = snapshot
+	}
+	return frames
+}
+
+// getClusterLock returns the mutex guarding clusterName, creating it on
+// first use so concurrent AddImg calls into different clusters don't
+// serialize on each other
+func (this *ImgDB) getClusterLock(clusterName string) *sync.Mutex {
+	actual, _ := this.clusterLocks.LoadOrStore(clusterName, &sync.Mutex{})
+	return actual.(*sync.Mutex)
+}
+
+// NamedBlob ...
+// Pairs an image name with its raw bytes for batch ingestion
+type NamedBlob struct {
+	Name string
+	Data []byte
+}
+
+// AddImgs ...
+// Concurrently ingests items across up to runtime.NumCPU() workers, since
+// decoding and feature extraction are CPU-bound and independent per
+// image. Per-item errors (including DupFileError) are collected without
+// aborting the rest of the batch; two items landing in the same cluster
+// within chiThresh of each other collapse to a single stored image via
+// the same duplicate check AddImg performs under its per-cluster lock.
+// If ctx is cancelled or times out, items not yet started are skipped and
+// get ctx.Err() instead of a result; items already in flight still run to
+// completion. Results and errors are returned in input order.
+func (this *ImgDB) AddImgs(ctx context.Context, items []NamedBlob) ([]*ImageFile, []error) {
+	results := make([]*ImageFile, len(items))
+	errs := make([]error, len(items))
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(runtime.NumCPU())
+	for i, item := range items {
+		i, item := i, item
+		g.Go(func() error {
+			if err := gctx.Err(); err != nil {
+				errs[i] = err
+				return nil
+			}
+			results[i], errs[i] = this.AddImg(item.Name, item.Data)
+			return nil
+		})
+	}
+	g.Wait()
+
+	return results, errs
+}
+
 // AddSource ...
 // Associate a link to a imagefile
 func (this *ImgDB) AddSource(imgModel *ImageFile, link string) {
@@ -208,6 +396,150 @@ func (this *ImgDB) SourceExists(link string) bool {
 	return len(sources) > 0
 }
 
+// Path ...
+// Returns the on-disk location of imgFile's stored bytes
+func (this *ImgDB) Path(imgFile ImageFile) string {
+	return filepath.Join(this.basePath, imgFile.Name+"."+imgFile.Format)
+}
+
+// Train ...
+// Inserts data as a new image via AddImg, then tags its cluster (if not
+// already labeled) with label. This turns the store into a supervised
+// nearest-neighbor classifier: Predict later looks up these labels.
+func (this *ImgDB) Train(label string, data []byte) error {
+	imgModel, err := this.AddImg(randomName(label), data)
+	if err != nil {
+		return err
+	}
+
+	// re-fetch: Association.Append set ClusterID on the persisted row,
+	// not on our local copy of imgModel
+	fresh := ImageFile{}
+	this.Find(&fresh, "name = ?", imgModel.Name)
+
+	cluster := Cluster{}
+	this.Find(&cluster, "id = ?", fresh.ClusterID)
+	if cluster.Label == "" {
+		cluster.Label = label
+		this.Save(&cluster)
+	}
+	return nil
+}
+
+// Predict ...
+// Runs k-NN over stored ImageFile.Index values using imgutil.ChiDist,
+// then aggregates neighbor labels by weighted vote (weight =
+// 1/(dist+epsilon)), returning the winning label and its normalized
+// confidence (winning weight / total weight). Ties on weight are broken
+// by the label with more supporting neighbors, then lexicographically,
+// so the result is deterministic across runs regardless of map iteration
+// order
+func (this *ImgDB) Predict(data []byte, k int) (label string, confidence float64, err error) {
+	matches, err := this.Query(data, k, imgutil.ChiDist)
+	if err != nil {
+		return
+	}
+
+	votes := map[string]float64{}
+	counts := map[string]int{}
+	var total float64
+	for _, match := range matches {
+		cluster := Cluster{}
+		this.Find(&cluster, "name = ?", match.ClusterName)
+		if cluster.Label == "" {
+			continue
+		}
+		weight := 1 / (match.Distance + labelEpsilon)
+		votes[cluster.Label] += weight
+		counts[cluster.Label]++
+		total += weight
+	}
+
+	if total == 0 {
+		err = fmt.Errorf("no labeled neighbors found among %d matches", len(matches))
+		return
+	}
+
+	label, best := pickWinningLabel(votes, counts)
+	confidence = best / total
+	return
+}
+
+// pickWinningLabel returns the label with the highest weighted vote,
+// breaking ties (by weight) in favor of more supporting neighbors, then
+// lexicographically, so the result is stable regardless of map
+// iteration order
+func pickWinningLabel(votes map[string]float64, counts map[string]int) (label string, best float64) {
+	var bestCount int
+	for l, w := range votes {
+		count := counts[l]
+		better := w > best ||
+			(w == best && count > bestCount) ||
+			(w == best && count == bestCount && l < label)
+		if better {
+			best = w
+			bestCount = count
+			label = l
+		}
+	}
+	return
+}
+
+// Query ...
+// Finds up to k of the images most similar to the input image, ranked by
+// dist. Candidates are pruned by bitApproximation cluster before ranking:
+// only images in clusters whose name is within clusterHamMax bits
+// (Hamming distance on the base64-encoded bit string) of the input's are
+// read and ranked. Every cluster name is loaded to measure that distance;
+// images in farther clusters are not considered.
+func (this *ImgDB) Query(img []byte, k int, dist DistanceFunc) (matches []ImageMatch, err error) {
+	if k <= 0 {
+		err = fmt.Errorf("k must be positive, got %d", k)
+		return
+	}
+
+	decoded, format, err := image.Decode(bytes.NewBuffer(img))
+	if err != nil {
+		return
+	}
+
+	features, err := this.extractFeatures(img, decoded, format)
+	if err != nil {
+		return
+	}
+	if features == nil {
+		err = fmt.Errorf("failed to extract features for query image")
+		return
+	}
+	clusterName := this.FeatConfig.Hash() + bitApproximation(features)
+
+	this.dbMutex.RLock()
+	clusters := getNeighborClusters(this, clusterName, clusterHamMax)
+	candidates := make([]ImageMatch, 0, len(clusters))
+	for _, cluster := range clusters {
+		cluster := cluster
+		for _, file := range getAssocs(this, &cluster) {
+			candidates = append(candidates, ImageMatch{
+				Name:        file.Name,
+				Format:      file.Format,
+				ClusterName: cluster.Name,
+				Path:        this.Path(file),
+				Distance:    dist(features, featureParse(file.Index)),
+			})
+		}
+	}
+	this.dbMutex.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Distance < candidates[j].Distance
+	})
+	if k < len(candidates) {
+		candidates = candidates[:k]
+	}
+	matches = candidates
+	return
+}
+
 //// Error Member
 
 // Error ...
@@ -226,6 +558,27 @@ func panicCheck(err error) {
 	}
 }
 
+// sanitizeName rejects names that would escape basePath once joined into
+// a filename (path separators, "..", empty names), since name ultimately
+// flows into os.Create(filepath.Join(this.basePath, name+"."+format))
+func sanitizeName(name string) (string, error) {
+	cleaned := filepath.Base(name)
+	if name == "" || cleaned != name || cleaned == "." || cleaned == ".." {
+		return "", fmt.Errorf("invalid image name %q", name)
+	}
+	return cleaned, nil
+}
+
+// randomName generates a unique-enough name prefixed by prefix, for
+// callers (like Train) that don't have a natural image name to give
+func randomName(prefix string) string {
+	var r [8]byte // ~ 10 ^ -19 prob of dup assuming perfect randomness
+	io.ReadFull(rando, r[:])
+	var appendage [16]byte
+	hex.Encode(appendage[:], r[:])
+	return prefix + "-" + string(appendage[:])
+}
+
 //// Data Serialization Utility
 
 // exact record of input float array
@@ -285,6 +638,39 @@ func b64Encode(i int) byte {
 	return byte(i)
 }
 
+// inverse of b64Encode
+func b64Decode(c byte) int {
+	switch {
+	case c == '-':
+		return 62
+	case c == '_':
+		return 63
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'A' && c <= 'Z':
+		return int(c-'A') + 10
+	default:
+		return int(c-'a') + 36
+	}
+}
+
+// hammingDist measures the bit-level Hamming distance between two
+// bitApproximation cluster names, treating mismatched lengths as
+// maximally distant on the extra characters
+func hammingDist(a, b string) int {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	dist := 0
+	for i := 0; i < n; i++ {
+		dist += bits.OnesCount(uint(b64Decode(a[i]) ^ b64Decode(b[i])))
+	}
+	dist += (len(a) - n) * 6
+	dist += (len(b) - n) * 6
+	return dist
+}
+
 //// Database Updates and Query
 
 // create cluster if not found
@@ -301,6 +687,22 @@ func getCluster(db *ImgDB, clusterName string) *Cluster {
 	return out
 }
 
+// fetch clusters whose name is within maxDist Hamming distance of clusterName
+func getNeighborClusters(db *ImgDB, clusterName string, maxDist int) []Cluster {
+	if db == nil {
+		panic("input db is nil")
+	}
+	all := []Cluster{}
+	db.Find(&all)
+	out := make([]Cluster, 0, len(all))
+	for _, cluster := range all {
+		if hammingDist(clusterName, cluster.Name) <= maxDist {
+			out = append(out, cluster)
+		}
+	}
+	return out
+}
+
 func createCluster(db *ImgDB, clusterName string) *Cluster {
 	if db == nil {
 		panic("input db is nil")
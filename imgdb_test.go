@@ -1,12 +1,19 @@
 package imgdb
 
 import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/gif"
 	"io/ioutil"
 	"math/rand"
 	"os"
 	"path/filepath"
 	"reflect"
 	"testing"
+
+	"github.com/mingkaic/imgdb/imgutil"
 )
 
 // =============================================
@@ -93,6 +100,99 @@ func TestPrivateGetAssoc(t *testing.T) {
 	})
 }
 
+func TestPrivateHammingDist(t *testing.T) {
+	if got := hammingDist("00", "00"); got != 0 {
+		t.Errorf("expecting 0 distance between identical cluster names, got %d", got)
+	}
+	if got := hammingDist("0", "1"); got != 1 {
+		t.Errorf("expecting 1 distance between '0' and '1', got %d", got)
+	}
+	if got := hammingDist("0", "00"); got != 6 {
+		t.Errorf("expecting length mismatch to count as 6, got %d", got)
+	}
+}
+
+func TestPrivatePickWinningLabel(t *testing.T) {
+	// weight tie between "cat" and "dog": more supporting neighbors wins
+	votes := map[string]float64{"cat": 1, "dog": 1}
+	counts := map[string]int{"cat": 1, "dog": 2}
+	for i := 0; i < 20; i++ {
+		if label, best := pickWinningLabel(votes, counts); label != "dog" || best != 1 {
+			t.Errorf("expecting dog (more support) to win the weight tie, got %s (%f)", label, best)
+		}
+	}
+
+	// weight and support both tied: lexicographically smaller wins
+	votes = map[string]float64{"zebra": 1, "ant": 1}
+	counts = map[string]int{"zebra": 1, "ant": 1}
+	for i := 0; i < 20; i++ {
+		if label, best := pickWinningLabel(votes, counts); label != "ant" || best != 1 {
+			t.Errorf("expecting ant to win the full tie lexicographically, got %s (%f)", label, best)
+		}
+	}
+
+	// no tie: highest weight wins outright
+	votes = map[string]float64{"cat": 2, "dog": 5}
+	counts = map[string]int{"cat": 1, "dog": 1}
+	if label, best := pickWinningLabel(votes, counts); label != "dog" || best != 5 {
+		t.Errorf("expecting dog to win on weight, got %s (%f)", label, best)
+	}
+}
+
+func TestPrivateSanitizeName(t *testing.T) {
+	for _, bad := range []string{"", ".", "..", "../escape", "a/../../b", "/etc/passwd", "a/b"} {
+		if _, err := sanitizeName(bad); err == nil {
+			t.Errorf("expecting %q to be rejected as an invalid image name", bad)
+		}
+	}
+	got, err := sanitizeName("mockfile")
+	if err != nil || got != "mockfile" {
+		t.Errorf("expecting plain name to pass through unchanged, got %q, %v", got, err)
+	}
+}
+
+func TestAddImgRejectsPathTraversal(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		_, err = db.AddImg("../../../../tmp/pwned_by_traversal", rawdata)
+		if err == nil {
+			t.Fatal("expecting AddImg to reject a path-traversing name")
+		}
+		if _, statErr := os.Stat("/tmp/pwned_by_traversal.jpeg"); statErr == nil {
+			t.Error("AddImg wrote outside of basePath")
+		}
+	})
+}
+
+func TestPrivatePHashRoundTrip(t *testing.T) {
+	// a dHash is essentially a random 64-bit pattern, so about half of all
+	// images produce a uint64 with the high bit set; ImageFile.PHash must
+	// survive that round-trip through the sqlite3-safe int64 column
+	var high uint64 = 1<<63 | 0x1234
+	stored := int64(high)
+	if uint64(stored) != high {
+		t.Errorf("expecting lossless round-trip through int64, got %d, want %d", uint64(stored), high)
+	}
+}
+
+func TestPrivateGetClusterLock(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		a := db.getClusterLock("clusterA")
+		b := db.getClusterLock("clusterA")
+		if a != b {
+			t.Errorf("expecting same lock instance for the same cluster name")
+		}
+		c := db.getClusterLock("clusterB")
+		if a == c {
+			t.Errorf("expecting distinct lock instances for distinct cluster names")
+		}
+	})
+}
+
 //// Public API Tests
 
 func TestAddImg(t *testing.T) {
@@ -138,6 +238,208 @@ func TestAddImg(t *testing.T) {
 	})
 }
 
+func TestAddImgs(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		items := []NamedBlob{
+			{Name: "batch1", Data: rawdata},
+			{Name: "batch2", Data: rawdata}, // duplicate of batch1
+		}
+		imgModels, errs := db.AddImgs(context.Background(), items)
+		if len(imgModels) != 2 || len(errs) != 2 {
+			t.Fatalf("expecting 2 results and 2 errors, got %d, %d", len(imgModels), len(errs))
+		}
+
+		// items race each other for the cluster lock, so which of the two
+		// wins is non-deterministic: assert on the invariant (exactly one
+		// success, one duplicate), not on which index won
+		var nSucceeded, nDuplicates int
+		for i, e := range errs {
+			switch {
+			case e == nil:
+				nSucceeded++
+				if imgModels[i] == nil || (imgModels[i].Name != "batch1" && imgModels[i].Name != "batch2") {
+					t.Errorf("expecting succeeding item named batch1 or batch2, got %v", imgModels[i])
+				}
+			default:
+				if _, ok := e.(*DupFileError); !ok {
+					t.Errorf("expecting failing item to be flagged as a duplicate, got %v", e)
+				}
+				nDuplicates++
+				if imgModels[i] != nil {
+					t.Errorf("expecting no model for a duplicate item, got %v", imgModels[i])
+				}
+			}
+		}
+		if nSucceeded != 1 || nDuplicates != 1 {
+			t.Errorf("expecting 1 success and 1 duplicate among batch items, got %d succeeded, %d duplicates", nSucceeded, nDuplicates)
+		}
+	})
+}
+
+func TestAddImgsCancelledContext(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		items := []NamedBlob{
+			{Name: "batch1", Data: rawdata},
+			{Name: "batch2", Data: rawdata},
+		}
+		imgModels, errs := db.AddImgs(ctx, items)
+		if len(imgModels) != 2 || len(errs) != 2 {
+			t.Fatalf("expecting 2 results and 2 errors, got %d, %d", len(imgModels), len(errs))
+		}
+		for i, e := range errs {
+			if e != context.Canceled {
+				t.Errorf("expecting item %d to report context.Canceled, got %v", i, e)
+			}
+			if imgModels[i] != nil {
+				t.Errorf("expecting no model for a cancelled item, got %v", imgModels[i])
+			}
+		}
+	})
+}
+
+func TestTrainPredict(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		if err := db.Train("cat", rawdata); err != nil {
+			t.Fatal(err)
+		}
+
+		label, confidence, err := db.Predict(rawdata, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if label != "cat" {
+			t.Errorf("expecting predicted label cat, got %s", label)
+		}
+		if confidence != 1 {
+			t.Errorf("expecting confidence 1 for an exact match, got %f", confidence)
+		}
+	})
+}
+
+func TestQuery(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		_, err = db.AddImg("mockfile", rawdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		matches, err := db.Query(rawdata, 5, imgutil.ChiDist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 {
+			t.Errorf("expecting 1 match, got %d", len(matches))
+		} else if matches[0].Name != "mockfile" {
+			t.Errorf("expecting match name mockfile, got %s", matches[0].Name)
+		} else if matches[0].Distance != 0 {
+			t.Errorf("expecting 0 distance for exact match, got %f", matches[0].Distance)
+		}
+	})
+}
+
+func TestAddImgQueryGif(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		rawdata := encodeGif(t)
+
+		_, err := db.AddImg("mockgif", rawdata)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Query must extract features the same way AddImg did (per-frame
+		// mean+variance), or this gif would never match its own indexed
+		// descriptor
+		matches, err := db.Query(rawdata, 5, imgutil.ChiDist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 {
+			t.Fatalf("expecting 1 match, got %d", len(matches))
+		}
+		if matches[0].Name != "mockgif" {
+			t.Errorf("expecting match name mockgif, got %s", matches[0].Name)
+		}
+		if matches[0].Distance != 0 {
+			t.Errorf("expecting 0 distance for exact match, got %f", matches[0].Distance)
+		}
+	})
+}
+
+func TestCompositeGifFramesOffsetSubframe(t *testing.T) {
+	// regression: real-world gif encoders store post-first frames as a
+	// "dirty rectangle" -- only the changed sub-region, at a non-zero
+	// offset -- rather than a full, origin-aligned canvas
+	anim := &gif.GIF{
+		Config: image.Config{Width: 20, Height: 20},
+		Image: []*image.Paletted{
+			solidPaletted(image.Rect(0, 0, 20, 20), color.White),
+			solidPaletted(image.Rect(10, 10, 20, 20), color.RGBA{R: 255, A: 255}),
+		},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalNone},
+		Delay:    []int{0, 0},
+	}
+
+	frames := compositeGifFrames(anim)
+	if len(frames) != 2 {
+		t.Fatalf("expecting 2 composited frames, got %d", len(frames))
+	}
+
+	second := frames[1]
+	if r, g, b, _ := second.At(15, 15).RGBA(); r>>8 != 255 || g>>8 != 0 || b>>8 != 0 {
+		t.Errorf("expecting red patch at (15,15), got (%d,%d,%d)", r>>8, g>>8, b>>8)
+	}
+	if r, g, b, _ := second.At(0, 0).RGBA(); r>>8 != 255 || g>>8 != 255 || b>>8 != 255 {
+		t.Errorf("expecting frame 1's white to persist outside the patch, got (%d,%d,%d)", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestNewRejectsInvalidFeatureConfig(t *testing.T) {
+	_, err := New("sqlite3", dbFile, outDir, imgutil.FeatureConfig{RBin: 0, GBin: 8, BBin: 8})
+	if err == nil {
+		t.Errorf("expecting zero bin count to be rejected")
+	}
+	os.Remove(dbFile)
+	cleanDir(outDir)
+}
+
+func TestQueryRejectsNonPositiveK(t *testing.T) {
+	testWrap(func(db *ImgDB) {
+		file, err := os.Open(filepath.Join("testimgs", "testimg.jpg"))
+		panicCheck(err)
+		rawdata, err := ioutil.ReadAll(file)
+		panicCheck(err)
+
+		for _, k := range []int{0, -1} {
+			if _, err := db.Query(rawdata, k, imgutil.ChiDist); err == nil {
+				t.Errorf("expecting k=%d to be rejected", k)
+			}
+		}
+	})
+}
+
 // =============================================
 //                    Private
 // =============================================
@@ -173,6 +475,45 @@ func cleanDir(dirpath string) {
 	os.Remove(dirpath)
 }
 
+// encodeGif builds a minimal 2-frame animated gif large enough to pass
+// ImgDB's default MinW/MinH filter
+func encodeGif(t *testing.T) []byte {
+	t.Helper()
+	palette := color.Palette{color.White, color.Black}
+	anim := &gif.GIF{}
+	for i := 0; i < 2; i++ {
+		frame := image.NewPaletted(image.Rect(0, 0, minLimit, minLimit), palette)
+		for y := 0; y < minLimit; y++ {
+			for x := 0; x < minLimit; x++ {
+				if (x+y+i)%2 == 0 {
+					frame.SetColorIndex(x, y, 0)
+				} else {
+					frame.SetColorIndex(x, y, 1)
+				}
+			}
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 0)
+	}
+
+	buf := new(bytes.Buffer)
+	panicCheck(gif.EncodeAll(buf, anim))
+	return buf.Bytes()
+}
+
+// solidPaletted builds a paletted image filling rect with c, for
+// exercising gif compositing at arbitrary frame bounds/offsets
+func solidPaletted(rect image.Rectangle, c color.Color) *image.Paletted {
+	palette := color.Palette{color.White, c}
+	frame := image.NewPaletted(rect, palette)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			frame.SetColorIndex(x, y, 1)
+		}
+	}
+	return frame
+}
+
 func genRandFeat(feats []float32) {
 	sum := 0
 	// randomly generate cluster
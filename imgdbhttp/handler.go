@@ -0,0 +1,207 @@
+//// file: imgdbhttp/handler.go
+
+// Package imgdbhttp ...
+// Exposes an imgdb.ImgDB as a REST service over HTTP
+package imgdbhttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mingkaic/imgdb"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// Handler ...
+// Wraps an *imgdb.ImgDB as an http.Handler exposing REST endpoints for
+// upload, retrieval, source management, cluster listing, and k-NN query
+type Handler struct {
+	db   *imgdb.ImgDB
+	dist imgdb.DistanceFunc
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// New ...
+// Constructs a Handler backed by db, using dist as the distance metric
+// for /query requests
+func New(db *imgdb.ImgDB, dist imgdb.DistanceFunc) *Handler {
+	return &Handler{db: db, dist: dist}
+}
+
+// ServeHTTP ...
+// Routes requests to the matching REST endpoint
+//
+//	POST   /images                  multipart upload -> AddImg
+//	GET    /images/{name}           stream stored file bytes (Range-aware)
+//	GET    /images/{name}/sources   list sources
+//	POST   /images/{name}/sources   add a source
+//	GET    /clusters/{name}/images  list images in a cluster
+//	POST   /query?k=10              k-NN retrieval
+func (this *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	segs := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case len(segs) == 1 && segs[0] == "images" && r.Method == http.MethodPost:
+		this.handleUpload(w, r)
+	case len(segs) == 2 && segs[0] == "images" && r.Method == http.MethodGet:
+		this.handleDownload(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "images" && segs[2] == "sources" && r.Method == http.MethodGet:
+		this.handleListSources(w, segs[1])
+	case len(segs) == 3 && segs[0] == "images" && segs[2] == "sources" && r.Method == http.MethodPost:
+		this.handleAddSource(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "clusters" && segs[2] == "images" && r.Method == http.MethodGet:
+		this.handleClusterImages(w, segs[1])
+	case len(segs) == 1 && segs[0] == "query" && r.Method == http.MethodPost:
+		this.handleQuery(w, r)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("no route for %s %s", r.Method, r.URL.Path))
+	}
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+func (this *Handler) handleUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	name := r.FormValue("name")
+	if name == "" {
+		name = strings.TrimSuffix(header.Filename, filenameExt(header.Filename))
+	}
+
+	imgModel, err := this.db.AddImg(name, data)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, imgModel)
+}
+
+func (this *Handler) handleDownload(w http.ResponseWriter, r *http.Request, name string) {
+	imgFiles := []imgdb.ImageFile{}
+	this.db.Find(&imgFiles, "name = ?", name)
+	if len(imgFiles) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("image %s not found", name))
+		return
+	}
+	imgFile := imgFiles[0]
+
+	file, err := os.Open(this.db.Path(imgFile))
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	// http.ServeContent handles Range requests, so large images support
+	// partial reads/seeks like a blob store
+	http.ServeContent(w, r, imgFile.Name+"."+imgFile.Format, info.ModTime(), file)
+}
+
+func (this *Handler) handleListSources(w http.ResponseWriter, name string) {
+	imgFiles := []imgdb.ImageFile{}
+	this.db.Find(&imgFiles, "name = ?", name)
+	if len(imgFiles) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("image %s not found", name))
+		return
+	}
+	sources := []imgdb.Source{}
+	this.db.Model(&imgFiles[0]).Association("Sources").Find(&sources)
+	writeJSON(w, http.StatusOK, sources)
+}
+
+func (this *Handler) handleAddSource(w http.ResponseWriter, r *http.Request, name string) {
+	var body struct {
+		Link string `json:"link"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	imgFiles := []imgdb.ImageFile{}
+	this.db.Find(&imgFiles, "name = ?", name)
+	if len(imgFiles) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("image %s not found", name))
+		return
+	}
+
+	this.db.AddSource(&imgFiles[0], body.Link)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (this *Handler) handleClusterImages(w http.ResponseWriter, name string) {
+	clusters := []imgdb.Cluster{}
+	this.db.Find(&clusters, "name = ?", name)
+	if len(clusters) == 0 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("cluster %s not found", name))
+		return
+	}
+	imgFiles := []imgdb.ImageFile{}
+	this.db.Model(&clusters[0]).Association("ImageFiles").Find(&imgFiles)
+	writeJSON(w, http.StatusOK, imgFiles)
+}
+
+func (this *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
+	k := 10
+	if kStr := r.URL.Query().Get("k"); kStr != "" {
+		parsed, err := strconv.Atoi(kStr)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid k: %s", kStr))
+			return
+		}
+		k = parsed
+	}
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	matches, err := this.db.Query(data, k, this.dist)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, matches)
+}
+
+func filenameExt(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[i:]
+	}
+	return ""
+}
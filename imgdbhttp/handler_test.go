@@ -0,0 +1,197 @@
+package imgdbhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mingkaic/imgdb"
+	"github.com/mingkaic/imgdb/imgutil"
+)
+
+const (
+	outDir = "testout"
+	dbFile = "test.db"
+)
+
+func testWrap(t *testing.T, test func(*imgdb.ImgDB, *Handler)) {
+	db, err := imgdb.New("sqlite3", dbFile, outDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	test(db, New(db, imgutil.ChiDist))
+
+	os.Remove(dbFile)
+	os.RemoveAll(outDir)
+}
+
+// uploadImage POSTs rawdata as name to /images and returns the response
+func uploadImage(h *Handler, name string, rawdata []byte) *httptest.ResponseRecorder {
+	body := new(bytes.Buffer)
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("image", name+".jpg")
+	part.Write(rawdata)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/images?name="+name, body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandleUploadAndDownload(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		rawdata, err := ioutil.ReadFile(filepath.Join("..", "testimgs", "testimg.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rec := uploadImage(h, "testimg", rawdata); rec.Code != http.StatusCreated {
+			t.Fatalf("expecting 201 on upload, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		getReq := httptest.NewRequest(http.MethodGet, "/images/testimg", nil)
+		getRec := httptest.NewRecorder()
+		h.ServeHTTP(getRec, getReq)
+		if getRec.Code != http.StatusOK {
+			t.Fatalf("expecting 200 on download, got %d: %s", getRec.Code, getRec.Body.String())
+		}
+		if !bytes.Equal(getRec.Body.Bytes(), rawdata) {
+			t.Errorf("downloaded bytes do not match uploaded bytes")
+		}
+	})
+}
+
+func TestHandleUploadDuplicateConflict(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		rawdata, err := ioutil.ReadFile(filepath.Join("..", "testimgs", "testimg.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if rec := uploadImage(h, "original", rawdata); rec.Code != http.StatusCreated {
+			t.Fatalf("expecting 201 on first upload, got %d", rec.Code)
+		}
+		if rec := uploadImage(h, "duplicate", rawdata); rec.Code != http.StatusConflict {
+			t.Errorf("expecting 409 on duplicate upload, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandleNotFound(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		req := httptest.NewRequest(http.MethodGet, "/images/missing", nil)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expecting 404 for missing image, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandleAddAndListSources(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		rawdata, err := ioutil.ReadFile(filepath.Join("..", "testimgs", "testimg.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec := uploadImage(h, "sourced", rawdata); rec.Code != http.StatusCreated {
+			t.Fatalf("expecting 201 on upload, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		addReq := httptest.NewRequest(http.MethodPost, "/images/sourced/sources",
+			strings.NewReader(`{"link":"http://example.com/a.jpg"}`))
+		addRec := httptest.NewRecorder()
+		h.ServeHTTP(addRec, addReq)
+		if addRec.Code != http.StatusNoContent {
+			t.Fatalf("expecting 204 on add source, got %d: %s", addRec.Code, addRec.Body.String())
+		}
+
+		listReq := httptest.NewRequest(http.MethodGet, "/images/sourced/sources", nil)
+		listRec := httptest.NewRecorder()
+		h.ServeHTTP(listRec, listReq)
+		if listRec.Code != http.StatusOK {
+			t.Fatalf("expecting 200 on list sources, got %d: %s", listRec.Code, listRec.Body.String())
+		}
+
+		var sources []imgdb.Source
+		if err := json.Unmarshal(listRec.Body.Bytes(), &sources); err != nil {
+			t.Fatal(err)
+		}
+		if len(sources) != 1 || sources[0].Link != "http://example.com/a.jpg" {
+			t.Errorf("expecting 1 source with the added link, got %+v", sources)
+		}
+	})
+}
+
+func TestHandleClusterImages(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		rawdata, err := ioutil.ReadFile(filepath.Join("..", "testimgs", "testimg.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := uploadImage(h, "clustered", rawdata)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expecting 201 on upload, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		// imgModel returned by the handler is a pre-association copy, so
+		// its ClusterID isn't populated yet; look up the persisted row
+		var imgModel imgdb.ImageFile
+		db.Find(&imgModel, "name = ?", "clustered")
+		var cluster imgdb.Cluster
+		db.Find(&cluster, "id = ?", imgModel.ClusterID)
+
+		listReq := httptest.NewRequest(http.MethodGet, "/clusters/"+cluster.Name+"/images", nil)
+		listRec := httptest.NewRecorder()
+		h.ServeHTTP(listRec, listReq)
+		if listRec.Code != http.StatusOK {
+			t.Fatalf("expecting 200 on cluster images, got %d: %s", listRec.Code, listRec.Body.String())
+		}
+
+		var imgFiles []imgdb.ImageFile
+		if err := json.Unmarshal(listRec.Body.Bytes(), &imgFiles); err != nil {
+			t.Fatal(err)
+		}
+		if len(imgFiles) != 1 || imgFiles[0].Name != "clustered" {
+			t.Errorf("expecting 1 image named clustered in its cluster, got %+v", imgFiles)
+		}
+	})
+}
+
+func TestHandleQuery(t *testing.T) {
+	testWrap(t, func(db *imgdb.ImgDB, h *Handler) {
+		rawdata, err := ioutil.ReadFile(filepath.Join("..", "testimgs", "testimg.jpg"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec := uploadImage(h, "queried", rawdata); rec.Code != http.StatusCreated {
+			t.Fatalf("expecting 201 on upload, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		queryReq := httptest.NewRequest(http.MethodPost, "/query?k=5", bytes.NewReader(rawdata))
+		queryRec := httptest.NewRecorder()
+		h.ServeHTTP(queryRec, queryReq)
+		if queryRec.Code != http.StatusOK {
+			t.Fatalf("expecting 200 on query, got %d: %s", queryRec.Code, queryRec.Body.String())
+		}
+
+		var matches []imgdb.ImageMatch
+		if err := json.Unmarshal(queryRec.Body.Bytes(), &matches); err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != 1 || matches[0].Name != "queried" {
+			t.Errorf("expecting 1 match named queried, got %+v", matches)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+//// file: imgdbhttp/response.go
+
+package imgdbhttp
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mingkaic/imgdb"
+)
+
+// =============================================
+//                    Private
+// =============================================
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// statusFor maps known imgdb errors to HTTP status codes
+func statusFor(err error) int {
+	if _, ok := err.(*imgdb.DupFileError); ok {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
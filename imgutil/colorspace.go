@@ -0,0 +1,117 @@
+//// file: imgutil/colorspace.go
+
+package imgutil
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// =============================================
+//                    Private
+// =============================================
+
+// toHSV wraps img so that At returns (H, S, V) packed into the (R, G, B)
+// channels, scaled back into [0,0xffff] so the existing histogram
+// binning logic can be reused unmodified
+func toHSV(img image.Image) image.Image {
+	return &convertedImage{img, rgbToHSVPixel}
+}
+
+// toLab wraps img so that At returns (L, a, b) packed into the (R, G, B)
+// channels, scaled back into [0,0xffff]
+func toLab(img image.Image) image.Image {
+	return &convertedImage{img, rgbToLabPixel}
+}
+
+type convertedImage struct {
+	image.Image
+	convert func(r, g, b uint32) (uint32, uint32, uint32)
+}
+
+func (this *convertedImage) At(x, y int) color.Color {
+	r, g, b, a := this.Image.At(x, y).RGBA()
+	cr, cg, cb := this.convert(r, g, b)
+	return color.RGBA64{R: uint16(cr), G: uint16(cg), B: uint16(cb), A: uint16(a)}
+}
+
+// rgbToHSVPixel maps RGBA() channels (each in [0,0xffff]) to HSV channels
+// rescaled back into [0,0xffff]
+func rgbToHSVPixel(r, g, b uint32) (uint32, uint32, uint32) {
+	rf := float64(r) / 0xffff
+	gf := float64(g) / 0xffff
+	bf := float64(b) / 0xffff
+	max := math.Max(rf, math.Max(gf, bf))
+	min := math.Min(rf, math.Min(gf, bf))
+	delta := max - min
+
+	var h float64
+	switch {
+	case delta == 0:
+		h = 0
+	case max == rf:
+		h = math.Mod((gf-bf)/delta, 6)
+	case max == gf:
+		h = (bf-rf)/delta + 2
+	default:
+		h = (rf-gf)/delta + 4
+	}
+	h *= 60
+	if h < 0 {
+		h += 360
+	}
+
+	var s float64
+	if max > 0 {
+		s = delta / max
+	}
+	v := max
+
+	return uint32(h / 360 * 0xffff), uint32(s * 0xffff), uint32(v * 0xffff)
+}
+
+// rgbToLabPixel is a standard sRGB -> CIE Lab conversion (D65 white
+// point), with each output channel rescaled into [0,0xffff]
+func rgbToLabPixel(r, g, b uint32) (uint32, uint32, uint32) {
+	toLinear := func(c uint32) float64 {
+		v := float64(c) / 0xffff
+		if v <= 0.04045 {
+			return v / 12.92
+		}
+		return math.Pow((v+0.055)/1.055, 2.4)
+	}
+	rl := toLinear(r)
+	gl := toLinear(g)
+	bl := toLinear(b)
+
+	x := rl*0.4124 + gl*0.3576 + bl*0.1805
+	y := rl*0.2126 + gl*0.7152 + bl*0.0722
+	z := rl*0.0193 + gl*0.1192 + bl*0.9505
+
+	const xn, yn, zn = 0.95047, 1.0, 1.08883
+	f := func(t float64) float64 {
+		if t > 0.008856 {
+			return math.Cbrt(t)
+		}
+		return 7.787*t + 16.0/116.0
+	}
+	fx := f(x / xn)
+	fy := f(y / yn)
+	fz := f(z / zn)
+
+	l := 116*fy - 16
+	a := 500 * (fx - fy)
+	bb := 200 * (fy - fz)
+
+	clamp := func(v, lo, hi float64) uint32 {
+		if v < lo {
+			v = lo
+		}
+		if v > hi {
+			v = hi
+		}
+		return uint32((v - lo) / (hi - lo) * 0xffff)
+	}
+	return clamp(l, 0, 100), clamp(a, -128, 127), clamp(bb, -128, 127)
+}
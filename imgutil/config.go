@@ -0,0 +1,79 @@
+//// file: imgutil/config.go
+
+package imgutil
+
+import (
+	"fmt"
+	"hash/fnv"
+)
+
+// =============================================
+//                    Declarations
+// =============================================
+
+// ResizeMethod ...
+// Specifies the interpolation algorithm used when resizing an image
+type ResizeMethod int
+
+const (
+	ResizeNearest ResizeMethod = iota
+	ResizeBilinear
+	ResizeLanczos
+)
+
+// ColorSpace ...
+// Specifies which colorspace histogram bins are computed in
+type ColorSpace int
+
+const (
+	ColorRGB ColorSpace = iota
+	ColorHSV
+	ColorLab
+)
+
+// FeatureConfig ...
+// Specifies how an image is normalized (resized, cropped, recolored)
+// before histogram construction, and how many bins the resulting
+// histogram uses per channel
+type FeatureConfig struct {
+	TargetWidth  uint
+	TargetHeight uint
+	CenterCrop   bool
+	Resize       ResizeMethod
+	Space        ColorSpace
+	RBin         uint32
+	GBin         uint32
+	BBin         uint32
+}
+
+// =============================================
+//                    Public
+// =============================================
+
+// DefaultFeatureConfig ...
+// Reproduces the original behavior: no resize/crop, RGB space, (8,8,8) bins
+func DefaultFeatureConfig() FeatureConfig {
+	return FeatureConfig{RBin: 8, GBin: 8, BBin: 8}
+}
+
+// Validate ...
+// Rejects bin counts that would divide by zero in RGBHistogram.Describe
+func (this FeatureConfig) Validate() error {
+	if this.RBin == 0 || this.GBin == 0 || this.BBin == 0 {
+		return fmt.Errorf("bin counts must be positive, got RBin=%d GBin=%d BBin=%d",
+			this.RBin, this.GBin, this.BBin)
+	}
+	return nil
+}
+
+// Hash ...
+// Produces a short deterministic fingerprint of this config, so that
+// features extracted under different configs never collide under the
+// same cluster name
+func (this FeatureConfig) Hash() string {
+	h := fnv.New32a()
+	fmt.Fprintf(h, "%d:%d:%t:%d:%d:%d:%d:%d",
+		this.TargetWidth, this.TargetHeight, this.CenterCrop,
+		this.Resize, this.Space, this.RBin, this.GBin, this.BBin)
+	return fmt.Sprintf("%08x", h.Sum32())
+}
@@ -0,0 +1,34 @@
+package imgutil
+
+import "testing"
+
+func TestFeatureConfigHash(t *testing.T) {
+	a := DefaultFeatureConfig()
+	b := DefaultFeatureConfig()
+	if a.Hash() != b.Hash() {
+		t.Errorf("expecting identical configs to hash identically, got %s != %s", a.Hash(), b.Hash())
+	}
+
+	c := a
+	c.TargetWidth = 256
+	c.TargetHeight = 256
+	if a.Hash() == c.Hash() {
+		t.Errorf("expecting different configs to hash differently, both got %s", a.Hash())
+	}
+}
+
+func TestFeatureConfigValidate(t *testing.T) {
+	if err := DefaultFeatureConfig().Validate(); err != nil {
+		t.Errorf("expecting default config to be valid, got %s", err)
+	}
+
+	for _, cfg := range []FeatureConfig{
+		{RBin: 0, GBin: 8, BBin: 8},
+		{RBin: 8, GBin: 0, BBin: 8},
+		{RBin: 8, GBin: 8, BBin: 0},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expecting zero bin count to be rejected, got nil error for %+v", cfg)
+		}
+	}
+}
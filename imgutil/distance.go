@@ -0,0 +1,58 @@
+//// file: imgutil/distance.go
+
+package imgutil
+
+import "math"
+
+// =============================================
+//                    Public
+// =============================================
+
+// EuclideanDist ...
+// Measures the straight-line distance between two feature vectors
+func EuclideanDist(feat1, feat2 []float32) float64 {
+	if len(feat1) != len(feat2) {
+		return math.Inf(1)
+	}
+	var accum float64
+	for i, f1 := range feat1 {
+		d := float64(f1 - feat2[i])
+		accum += d * d
+	}
+	return math.Sqrt(accum)
+}
+
+// CosineDist ...
+// Measures the cosine distance (1 - cosine similarity) between two feature vectors
+func CosineDist(feat1, feat2 []float32) float64 {
+	if len(feat1) != len(feat2) {
+		return math.Inf(1)
+	}
+	var dot, mag1, mag2 float64
+	for i, f1 := range feat1 {
+		f2 := feat2[i]
+		dot += float64(f1) * float64(f2)
+		mag1 += float64(f1) * float64(f1)
+		mag2 += float64(f2) * float64(f2)
+	}
+	if mag1 == 0 || mag2 == 0 {
+		return 1
+	}
+	return 1 - dot/(math.Sqrt(mag1)*math.Sqrt(mag2))
+}
+
+// BhattacharyyaDist ...
+// Measures the Bhattacharyya distance between two probability distributions
+func BhattacharyyaDist(feat1, feat2 []float32) float64 {
+	if len(feat1) != len(feat2) {
+		return math.Inf(1)
+	}
+	var bc float64
+	for i, f1 := range feat1 {
+		bc += math.Sqrt(float64(f1) * float64(feat2[i]))
+	}
+	if bc <= 0 {
+		return math.Inf(1)
+	}
+	return -math.Log(bc)
+}
@@ -0,0 +1,72 @@
+package imgutil
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// =============================================
+//                    Tests
+// =============================================
+
+func TestEuclideanDist(t *testing.T) {
+	var gen = rand.New(rand.NewSource(time.Now().Unix()))
+	for i := 0; i < 3000; i++ {
+		sample, similar, opposite := randFeatures(gen)
+		minDist := EuclideanDist(sample, similar)
+		maxDist := EuclideanDist(sample, opposite)
+		if minDist > maxDist {
+			t.Errorf("expect similar distance %f less than opposite distance %f", minDist, maxDist)
+		}
+	}
+}
+
+func TestCosineDist(t *testing.T) {
+	var gen = rand.New(rand.NewSource(time.Now().Unix()))
+	for i := 0; i < 3000; i++ {
+		sample, similar, opposite := randFeatures(gen)
+		minDist := CosineDist(sample, similar)
+		maxDist := CosineDist(sample, opposite)
+		if minDist > maxDist {
+			t.Errorf("expect similar distance %f less than opposite distance %f", minDist, maxDist)
+		}
+	}
+}
+
+func TestBhattacharyyaDist(t *testing.T) {
+	// unlike Euclidean/Cosine, Bhattacharyya assumes both inputs are
+	// normalized probability distributions (sum to 1); randFeatures'
+	// "opposite" (1-sample) isn't one, so it gets its own fixture here
+	var gen = rand.New(rand.NewSource(time.Now().Unix()))
+	for i := 0; i < 3000; i++ {
+		sample, similar, opposite := randProbFeatures(gen)
+		minDist := BhattacharyyaDist(sample, similar)
+		maxDist := BhattacharyyaDist(sample, opposite)
+		if minDist > maxDist {
+			t.Errorf("expect similar distance %f less than opposite distance %f", minDist, maxDist)
+		}
+	}
+}
+
+// randProbFeatures is like randFeatures, but renormalizes "opposite" so
+// all three outputs are valid probability distributions (sum to 1),
+// which Bhattacharyya distance assumes
+func randProbFeatures(gen *rand.Rand) (sample, similar, opposite []float32) {
+	sample, similar, opposite = randFeatures(gen)
+	normalizeSum(opposite)
+	return
+}
+
+func normalizeSum(feat []float32) {
+	var sum float32
+	for _, v := range feat {
+		sum += v
+	}
+	if sum == 0 {
+		return
+	}
+	for i, v := range feat {
+		feat[i] = v / sum
+	}
+}
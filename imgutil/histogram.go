@@ -28,10 +28,10 @@ const (
 // =============================================
 
 // New ...
-// Create a new RGBHistogram with # of bins matching input values
-func New(r, g, b uint32) *RGBHistogram {
-	nCount := r * g * b
-	return &RGBHistogram{r, g, b, make([]float32, nCount)}
+// Create a new RGBHistogram with # of bins matching cfg
+func New(cfg FeatureConfig) *RGBHistogram {
+	nCount := cfg.RBin * cfg.GBin * cfg.BBin
+	return &RGBHistogram{cfg.RBin, cfg.GBin, cfg.BBin, make([]float32, nCount)}
 }
 
 // Describe ...
@@ -70,16 +70,31 @@ func (this *RGBHistogram) Clear() {
 }
 
 // GenerateFeature ...
-// Grabs just the histogram values from input image
-// And performs a format check
-func GenerateFeature(img image.Image, format string) []float32 {
-	if format == "png" || format == "jpeg" {
-		// extract color features and store on db
-		histo := New(8, 8, 8)
-		histo.Describe(img)
-		return histo.Feature
+// Normalizes input image per cfg (center-crop, resize, colorspace
+// conversion), then grabs the histogram values
+// Performs a format check
+func GenerateFeature(img image.Image, format string, cfg FeatureConfig) []float32 {
+	if format != "png" && format != "jpeg" && format != "gif" {
+		return nil
 	}
-	return nil
+	pre := img
+	if cfg.CenterCrop {
+		pre = centerCrop(pre)
+	}
+	if cfg.TargetWidth > 0 && cfg.TargetHeight > 0 {
+		pre = resize(pre, cfg.TargetWidth, cfg.TargetHeight, cfg.Resize)
+	}
+	switch cfg.Space {
+	case ColorHSV:
+		pre = toHSV(pre)
+	case ColorLab:
+		pre = toLab(pre)
+	}
+
+	// extract color features and store on db
+	histo := New(cfg)
+	histo.Describe(pre)
+	return histo.Feature
 }
 
 // ChiDist ...
@@ -44,7 +44,7 @@ func TestMain(m *testing.M) {
 }
 
 func TestHistogram(t *testing.T) {
-	histo := New(2, 2, 2)
+	histo := New(FeatureConfig{RBin: 2, GBin: 2, BBin: 2})
 	for color, exFeats := range colorMaps {
 		file, err := os.Open(filepath.Join("..", "testimgs", color+".jpg"))
 		if err != nil {
@@ -63,7 +63,8 @@ func TestHistogram(t *testing.T) {
 }
 
 func TestGenerateFeature(t *testing.T) {
-	nilFeat := GenerateFeature(nil, "bad format")
+	cfg := DefaultFeatureConfig()
+	nilFeat := GenerateFeature(nil, "bad format", cfg)
 	if nilFeat != nil {
 		t.Errorf("failed to notify bad format by returning nil features")
 	}
@@ -76,7 +77,7 @@ func TestGenerateFeature(t *testing.T) {
 		if err != nil {
 			panic(err)
 		}
-		feat := GenerateFeature(img, "jpeg")
+		feat := GenerateFeature(img, "jpeg", cfg)
 		if len(feat) != 512 {
 			t.Errorf("expecting 512 features, got %d", len(feat))
 		} else if !reflect.DeepEqual(exFeats, feat) {
@@ -0,0 +1,47 @@
+//// file: imgutil/multiframe.go
+
+package imgutil
+
+import "image"
+
+// =============================================
+//                    Public
+// =============================================
+
+// GenerateMultiFrameFeature ...
+// Computes a single feature vector representative of an animated image
+// by combining per-frame histograms into their mean and variance (mean
+// bins followed by variance bins), so the result stays a fixed size
+// regardless of frame count
+func GenerateMultiFrameFeature(frames []image.Image, cfg FeatureConfig) []float32 {
+	if len(frames) == 0 {
+		return nil
+	}
+	nBins := int(cfg.RBin * cfg.GBin * cfg.BBin)
+	sums := make([]float64, nBins)
+	sumSqs := make([]float64, nBins)
+	for _, frame := range frames {
+		feat := GenerateFeature(frame, "gif", cfg)
+		if feat == nil {
+			return nil
+		}
+		for i, v := range feat {
+			fv := float64(v)
+			sums[i] += fv
+			sumSqs[i] += fv * fv
+		}
+	}
+
+	n := float64(len(frames))
+	out := make([]float32, nBins*2)
+	for i := 0; i < nBins; i++ {
+		mean := sums[i] / n
+		variance := sumSqs[i]/n - mean*mean
+		if variance < 0 {
+			variance = 0
+		}
+		out[i] = float32(mean)
+		out[nBins+i] = float32(variance)
+	}
+	return out
+}
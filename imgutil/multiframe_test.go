@@ -0,0 +1,30 @@
+package imgutil
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestGenerateMultiFrameFeature(t *testing.T) {
+	cfg := FeatureConfig{RBin: 2, GBin: 2, BBin: 2}
+	nilFeat := GenerateMultiFrameFeature(nil, cfg)
+	if nilFeat != nil {
+		t.Errorf("expecting nil feature for no frames")
+	}
+
+	frames := []image.Image{
+		solidImage(4, 4, color.Black),
+		solidImage(4, 4, color.Black),
+	}
+	feat := GenerateMultiFrameFeature(frames, cfg)
+	nBins := 8
+	if len(feat) != nBins*2 {
+		t.Fatalf("expecting %d features (mean+variance), got %d", nBins*2, len(feat))
+	}
+	for i := 0; i < nBins; i++ {
+		if feat[nBins+i] != 0 {
+			t.Errorf("expecting 0 variance across identical frames at bin %d, got %f", i, feat[nBins+i])
+		}
+	}
+}
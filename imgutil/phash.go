@@ -0,0 +1,67 @@
+//// file: imgutil/phash.go
+
+package imgutil
+
+import (
+	"image"
+	"math/bits"
+)
+
+// =============================================
+//                    Globals
+// =============================================
+
+const (
+	phashWidth  = 9
+	phashHeight = 8
+)
+
+// =============================================
+//                    Public
+// =============================================
+
+// PerceptualHash ...
+// Computes a 64-bit difference hash (dHash): resizes img down to 9x8
+// grayscale, then sets bit i whenever pixel i is brighter than its right
+// neighbor. Visually similar images land on nearby bit patterns, unlike
+// the color histogram, which can be fooled by identical palettes on
+// entirely different subjects
+func PerceptualHash(img image.Image) uint64 {
+	small := toGrayscale(resize(img, phashWidth, phashHeight, ResizeBilinear))
+	bounds := small.Bounds()
+
+	var hash uint64
+	bit := uint(0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X-1; x++ {
+			left := small.GrayAt(x, y).Y
+			right := small.GrayAt(x+1, y).Y
+			if left > right {
+				hash |= 1 << bit
+			}
+			bit++
+		}
+	}
+	return hash
+}
+
+// HammingDist ...
+// Counts the number of differing bits between two perceptual hashes
+func HammingDist(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// =============================================
+//                    Private
+// =============================================
+
+func toGrayscale(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	out := image.NewGray(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out.Set(x, y, img.At(x, y))
+		}
+	}
+	return out
+}
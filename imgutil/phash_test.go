@@ -0,0 +1,28 @@
+package imgutil
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestPerceptualHashIdenticalImages(t *testing.T) {
+	a := solidImage(32, 32, color.RGBA{R: 10, G: 200, B: 30, A: 255})
+	b := solidImage(32, 32, color.RGBA{R: 10, G: 200, B: 30, A: 255})
+	ha := PerceptualHash(a)
+	hb := PerceptualHash(b)
+	if dist := HammingDist(ha, hb); dist != 0 {
+		t.Errorf("expecting 0 Hamming distance between identical images, got %d", dist)
+	}
+}
+
+func TestHammingDist(t *testing.T) {
+	if dist := HammingDist(0, 0); dist != 0 {
+		t.Errorf("expecting 0 distance for identical hashes, got %d", dist)
+	}
+	if dist := HammingDist(0, 1); dist != 1 {
+		t.Errorf("expecting 1 distance for single bit flip, got %d", dist)
+	}
+	if dist := HammingDist(0, ^uint64(0)); dist != 64 {
+		t.Errorf("expecting 64 distance for fully inverted hash, got %d", dist)
+	}
+}
@@ -0,0 +1,214 @@
+//// file: imgutil/resize.go
+
+package imgutil
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// =============================================
+//                    Private
+// =============================================
+
+// centerCrop crops the largest centered square out of img; the result's
+// bounds start at the origin, since RGBHistogram.Describe reads pixels
+// from (0,0)
+func centerCrop(img image.Image) image.Image {
+	bounds := img.Bounds()
+	dx := bounds.Dx()
+	dy := bounds.Dy()
+	side := dx
+	if dy < side {
+		side = dy
+	}
+	x0 := bounds.Min.X + (dx-side)/2
+	y0 := bounds.Min.Y + (dy-side)/2
+	return cropImage{img, image.Rect(0, 0, side, side), image.Pt(x0, y0)}
+}
+
+type cropImage struct {
+	image.Image
+	rect   image.Rectangle
+	offset image.Point
+}
+
+func (this cropImage) Bounds() image.Rectangle {
+	return this.rect
+}
+
+func (this cropImage) At(x, y int) color.Color {
+	return this.Image.At(x+this.offset.X, y+this.offset.Y)
+}
+
+// resize scales img to exactly w x h using the given interpolation method
+func resize(img image.Image, w, h uint, method ResizeMethod) image.Image {
+	switch method {
+	case ResizeNearest:
+		return resizeNearest(img, w, h)
+	case ResizeLanczos:
+		return resizeLanczos(img, w, h)
+	default:
+		return resizeBilinear(img, w, h)
+	}
+}
+
+func resizeNearest(img image.Image, w, h uint) image.Image {
+	bounds := img.Bounds()
+	srcW := bounds.Dx()
+	srcH := bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	for y := 0; y < int(h); y++ {
+		sy := bounds.Min.Y + y*srcH/int(h)
+		for x := 0; x < int(w); x++ {
+			sx := bounds.Min.X + x*srcW/int(w)
+			out.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return out
+}
+
+func resizeBilinear(img image.Image, w, h uint) image.Image {
+	bounds := img.Bounds()
+	srcW := bounds.Dx()
+	srcH := bounds.Dy()
+	out := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	xRatio := float64(srcW) / float64(w)
+	yRatio := float64(srcH) / float64(h)
+	for y := 0; y < int(h); y++ {
+		fy := float64(y) * yRatio
+		y0 := int(fy)
+		y1 := y0 + 1
+		if y1 >= srcH {
+			y1 = srcH - 1
+		}
+		wy := fy - float64(y0)
+		for x := 0; x < int(w); x++ {
+			fx := float64(x) * xRatio
+			x0 := int(fx)
+			x1 := x0 + 1
+			if x1 >= srcW {
+				x1 = srcW - 1
+			}
+			wx := fx - float64(x0)
+
+			c00 := img.At(bounds.Min.X+x0, bounds.Min.Y+y0)
+			c10 := img.At(bounds.Min.X+x1, bounds.Min.Y+y0)
+			c01 := img.At(bounds.Min.X+x0, bounds.Min.Y+y1)
+			c11 := img.At(bounds.Min.X+x1, bounds.Min.Y+y1)
+			out.Set(x, y, bilerp(c00, c10, c01, c11, wx, wy))
+		}
+	}
+	return out
+}
+
+func bilerp(c00, c10, c01, c11 color.Color, wx, wy float64) color.Color {
+	r00, g00, b00, a00 := c00.RGBA()
+	r10, g10, b10, a10 := c10.RGBA()
+	r01, g01, b01, a01 := c01.RGBA()
+	r11, g11, b11, a11 := c11.RGBA()
+
+	lerp := func(v00, v10, v01, v11 uint32) uint16 {
+		top := float64(v00)*(1-wx) + float64(v10)*wx
+		bot := float64(v01)*(1-wx) + float64(v11)*wx
+		return uint16(top*(1-wy) + bot*wy)
+	}
+	return color.RGBA64{
+		R: lerp(r00, r10, r01, r11),
+		G: lerp(g00, g10, g01, g11),
+		B: lerp(b00, b10, b01, b11),
+		A: lerp(a00, a10, a01, a11),
+	}
+}
+
+// lanczosKernel evaluates the Lanczos-3 kernel at x
+func lanczosKernel(x float64) float64 {
+	const a = 3
+	if x == 0 {
+		return 1
+	}
+	if x < -a || x > a {
+		return 0
+	}
+	piX := math.Pi * x
+	return a * math.Sin(piX) * math.Sin(piX/a) / (piX * piX)
+}
+
+// resizeLanczos scales img via separable Lanczos-3 convolution: a
+// horizontal pass followed by a vertical pass
+func resizeLanczos(img image.Image, w, h uint) image.Image {
+	bounds := img.Bounds()
+	srcW := bounds.Dx()
+	srcH := bounds.Dy()
+
+	tmp := image.NewRGBA(image.Rect(0, 0, int(w), srcH))
+	xRatio := float64(srcW) / float64(w)
+	for y := 0; y < srcH; y++ {
+		row := float64(bounds.Min.Y + y)
+		for x := 0; x < int(w); x++ {
+			fx := (float64(x)+0.5)*xRatio - 0.5
+			tmp.Set(x, y, lanczosSample(img, fx, row, true, srcW))
+		}
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, int(w), int(h)))
+	yRatio := float64(srcH) / float64(h)
+	for y := 0; y < int(h); y++ {
+		fy := (float64(y)+0.5)*yRatio - 0.5
+		for x := 0; x < int(w); x++ {
+			out.Set(x, y, lanczosSample(tmp, float64(x), fy, false, srcH))
+		}
+	}
+	return out
+}
+
+// lanczosSample convolves the Lanczos-3 kernel over integer neighbors
+// along one axis (horizontal when sampling the row pass, vertical
+// otherwise) of a fractional coordinate
+func lanczosSample(img image.Image, fx, fy float64, horizontal bool, srcLen int) color.Color {
+	const a = 3
+	bounds := img.Bounds()
+	center := fx
+	if !horizontal {
+		center = fy
+	}
+	lo := int(math.Floor(center)) - a + 1
+	hi := int(math.Floor(center)) + a
+	var r, g, b, al, wsum float64
+	for i := lo; i <= hi; i++ {
+		if i < 0 || i >= srcLen {
+			continue
+		}
+		weight := lanczosKernel(center - float64(i))
+		if weight == 0 {
+			continue
+		}
+		var px, py int
+		if horizontal {
+			px, py = bounds.Min.X+i, int(fy)
+		} else {
+			px, py = int(fx), bounds.Min.Y+i
+		}
+		cr, cg, cb, ca := img.At(px, py).RGBA()
+		r += float64(cr) * weight
+		g += float64(cg) * weight
+		b += float64(cb) * weight
+		al += float64(ca) * weight
+		wsum += weight
+	}
+	if wsum == 0 {
+		wsum = 1
+	}
+	clamp := func(v float64) uint16 {
+		v /= wsum
+		if v < 0 {
+			v = 0
+		}
+		if v > 0xffff {
+			v = 0xffff
+		}
+		return uint16(v)
+	}
+	return color.RGBA64{R: clamp(r), G: clamp(g), B: clamp(b), A: clamp(al)}
+}
@@ -0,0 +1,56 @@
+package imgutil
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func solidImage(w, h int, c color.Color) image.Image {
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, c)
+		}
+	}
+	return out
+}
+
+func TestResizeDimensions(t *testing.T) {
+	src := solidImage(10, 20, color.White)
+	for _, method := range []ResizeMethod{ResizeNearest, ResizeBilinear, ResizeLanczos} {
+		out := resize(src, 4, 4, method)
+		bounds := out.Bounds()
+		if bounds.Dx() != 4 || bounds.Dy() != 4 {
+			t.Errorf("expecting 4x4 output for method %d, got %dx%d", method, bounds.Dx(), bounds.Dy())
+		}
+	}
+}
+
+func TestResizeSolidColorPreserved(t *testing.T) {
+	src := solidImage(10, 10, color.RGBA{R: 100, G: 150, B: 200, A: 255})
+	for _, method := range []ResizeMethod{ResizeNearest, ResizeBilinear, ResizeLanczos} {
+		out := resize(src, 5, 5, method)
+		r, g, b, _ := out.At(2, 2).RGBA()
+		wantR, wantG, wantB, _ := color.RGBA{R: 100, G: 150, B: 200, A: 255}.RGBA()
+		if absDiff(r, wantR) > 0x200 || absDiff(g, wantG) > 0x200 || absDiff(b, wantB) > 0x200 {
+			t.Errorf("method %d: expecting solid color to be preserved, got (%d, %d, %d)", method, r, g, b)
+		}
+	}
+}
+
+func TestCenterCrop(t *testing.T) {
+	src := solidImage(10, 20, color.White)
+	cropped := centerCrop(src)
+	bounds := cropped.Bounds()
+	if bounds.Dx() != 10 || bounds.Dy() != 10 {
+		t.Errorf("expecting centered 10x10 crop, got %dx%d", bounds.Dx(), bounds.Dy())
+	}
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}